@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// openSystemLog connects to the platform log facility named by a -log-target entry
+func openSystemLog(target string) (systemLogger, error) {
+	if target != "syslog" {
+		return nil, fmt.Errorf("the Windows Event Log is only available on Windows")
+	}
+	return syslog.New(syslog.LOG_INFO|syslog.LOG_USER, "docker-autostart")
+}
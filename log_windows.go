@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// eventID is the ID every event is reported under; the message carries the detail
+const eventID = 1
+
+// eventLog writes to the Application log under the docker-autostart source. The source is not
+// installed by the tool (that needs admin rights); see the -log-target notes in the README.
+type eventLog struct {
+	log *eventlog.Log
+}
+
+// openSystemLog connects to the platform log facility named by a -log-target entry
+func openSystemLog(target string) (systemLogger, error) {
+	if target != "eventlog" {
+		return nil, fmt.Errorf("syslog is not available on Windows, use eventlog")
+	}
+	log, err := eventlog.Open("docker-autostart")
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{log: log}, nil
+}
+
+func (l *eventLog) Info(message string) error {
+	return l.log.Info(eventID, message)
+}
+
+func (l *eventLog) Err(message string) error {
+	return l.log.Error(eventID, message)
+}
+
+func (l *eventLog) Close() error {
+	return l.log.Close()
+}
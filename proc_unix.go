@@ -0,0 +1,99 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup runs cmd in its own process group so the whole tree can be signalled
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessTree kills cmd and every child in its process group
+func killProcessTree(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// interruptProcessTree sends SIGTERM to cmd's process group so every process in it can exit cleanly
+func interruptProcessTree(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// detachProcess starts cmd in its own session so it survives the parent and its terminal exiting
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// terminateSpawned sends SIGTERM to a launch process; sudo and systemd-run relay it to what they run.
+// Launches stay in the terminal's process group so sudo can prompt, which rules out a group kill.
+func terminateSpawned(process *os.Process) error {
+	return process.Signal(syscall.SIGTERM)
+}
+
+// startLockName resolves -start-lock to a lock file path, shared by every user for "system"
+func startLockName(value string) string {
+	switch value {
+	case "system":
+		return filepath.Join(os.TempDir(), "docker-autostart.lock")
+	case "user":
+		return filepath.Join(os.TempDir(), fmt.Sprintf("docker-autostart-%d.lock", os.Getuid()))
+	}
+	return value
+}
+
+// startLockPoll is how often acquireStartLock retries a lock held by another caller
+var startLockPoll = 100 * time.Millisecond
+
+// acquireStartLock waits up to timeout for an exclusive flock on path.
+// The "system" lock lives in a shared temp directory, so symlinks and non-regular files are refused
+// and only a file this call created is made writable for other users.
+func acquireStartLock(path string, timeout time.Duration) (func(), error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0666)
+	if err == nil {
+		// The umask usually strips group/other write, which would lock out other users
+		file.Chmod(0666)
+	} else if errors.Is(err, os.ErrExist) {
+		file, err = os.OpenFile(path, os.O_RDWR|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if linkInfo, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() || !os.SameFile(info, linkInfo) {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			file.Close()
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("%s is still held by another caller after %v", path, timeout)
+		}
+		time.Sleep(startLockPoll)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,380 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKillProcessTree(t *testing.T) {
+	// The background sleep inherits stdout, so Wait only returns once it has died too
+	var output bytes.Buffer
+	cmd := exec.Command("sh", "-c", "sleep 30 & wait")
+	cmd.Stdout = &output
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	if err := killProcessTree(cmd); err != nil {
+		t.Fatalf("killProcessTree() error = %v", err)
+	}
+	cmd.Wait()
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("process tree took %v to die, child survived killProcessTree", elapsed)
+	}
+}
+
+func TestAcquireStartLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "start.lock")
+	release, err := acquireStartLock(path, time.Minute)
+	if err != nil {
+		t.Fatalf("acquireStartLock() error = %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		second, err := acquireStartLock(path, time.Minute)
+		if err != nil {
+			t.Errorf("second acquireStartLock() error = %v", err)
+		} else {
+			second()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second caller acquired the lock while it was held")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second caller never acquired the lock after release")
+	}
+}
+
+func TestAcquireStartLockTimesOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "start.lock")
+	release, err := acquireStartLock(path, time.Minute)
+	if err != nil {
+		t.Fatalf("acquireStartLock() error = %v", err)
+	}
+	defer release()
+
+	start := time.Now()
+	if _, err := acquireStartLock(path, 300*time.Millisecond); err == nil {
+		t.Fatal("acquireStartLock() should give up while another caller holds the lock")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("acquireStartLock() took %v to give up", elapsed)
+	}
+}
+
+func TestAcquireStartLockRefusesSymlink(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	if err := os.WriteFile(victim, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "start.lock")
+	if err := os.Symlink(victim, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if release, err := acquireStartLock(path, time.Second); err == nil {
+		release()
+		t.Fatal("acquireStartLock() should refuse a symlinked lock file")
+	}
+	info, err := os.Stat(victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("symlink target mode = %v, want it left at 0600", perm)
+	}
+}
+
+func TestKillSpawned(t *testing.T) {
+	defer func() { spawned = nil }()
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	spawned = append(spawned, cmd.Process)
+
+	*quiet = true
+	defer func() { *quiet = false }()
+	killSpawned()
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("spawned process survived killSpawned")
+	}
+	if len(spawned) != 0 {
+		t.Errorf("spawned = %v after killSpawned, want empty", spawned)
+	}
+}
+
+func TestStartTracksLinuxStartCmd(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("-linux-start-cmd is only used on Linux")
+	}
+	defer func() {
+		spawned = nil
+		*linuxStartCmd = ""
+		*quiet = false
+	}()
+	*quiet = true
+	*linuxStartCmd = "sleep 30"
+
+	if err := startDockerDesktop(); err != nil {
+		t.Fatal(err)
+	}
+	if len(spawned) != 1 {
+		t.Fatalf("spawned = %v, want the -linux-start-cmd process tracked", spawned)
+	}
+	process := spawned[0]
+	killSpawned()
+	if _, err := process.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandTimeoutEscalates(t *testing.T) {
+	defer func() { *cmdTimeout, *cmdKillGrace = 0, 10*time.Second }()
+	dir := t.TempDir()
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	marker := filepath.Join(dir, "cleaned-up")
+	*cmdTimeout = 200 * time.Millisecond
+
+	// A command that cleans up on SIGTERM exits within the grace
+	writeFakeDocker(t, dir, "trap 'touch "+marker+"; exit 0' TERM\nsleep 30 &\nwait\n")
+	*cmdKillGrace = 5 * time.Second
+	start := time.Now()
+	if code := executeDockerCommand([]string{"compose", "up"}); code != exitCommandTimeout {
+		t.Errorf("exit code = %d, want %d", code, exitCommandTimeout)
+	}
+	if _, err := os.Stat(marker); err != nil || time.Since(start) > 3*time.Second {
+		t.Errorf("command did not clean up on SIGTERM (marker: %v, took %v)", err, time.Since(start))
+	}
+
+	// One that ignores SIGTERM is killed once the grace runs out
+	writeFakeDocker(t, dir, "trap '' TERM\nsleep 30\n")
+	*cmdKillGrace = 300 * time.Millisecond
+	start = time.Now()
+	if code := executeDockerCommand([]string{"compose", "up"}); code != exitCommandTimeout {
+		t.Errorf("exit code = %d, want %d", code, exitCommandTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command ignoring SIGTERM took %v to be killed", elapsed)
+	}
+}
+
+// writeFakeDocker puts a docker shell script with the given body in dir
+func writeFakeDocker(t *testing.T, dir, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnsureReadyRunningProbesEndpoints(t *testing.T) {
+	defer func() {
+		processCheck = isDockerDesktopRunning
+		*dockerCLI = "docker"
+		*timeout = 120
+		*requireMode = "all"
+		contexts = nil
+		runActivity = nil
+	}()
+	dir := t.TempDir()
+	writeFakeDocker(t, dir, "[ \"$1 $2\" = \"--context up\" ]\n")
+	processCheck = func() bool { return true }
+	*dockerCLI = filepath.Join(dir, "docker")
+	*timeout = 1
+	contexts = stringList{"up", "down"}
+	t.Setenv("HOME", t.TempDir())
+	runActivity = nil
+
+	result, err := ensureReady()
+	if err == nil {
+		t.Errorf("ensureReady() = %+v with -require all and the down context unreachable, want an error", result)
+	}
+	if !result.AlreadyRunning || result.Started {
+		t.Errorf("result = %+v, want an already running Docker and nothing started", result)
+	}
+
+	*requireMode = "any"
+	if result, err := ensureReady(); err != nil || result.Method != "info" {
+		t.Errorf("ensureReady() = %+v, %v with -require any, want ready through the up context", result, err)
+	}
+}
+
+func TestDoctorBackendChecks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dockerd"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	// A plain Linux host with dockerd passes without Docker Desktop installed
+	for _, check := range doctorBackendChecks("systemd") {
+		if !check.ok {
+			t.Errorf("systemd backend check %s failed (%s), want it skipped or passing", check.name, check.detail)
+		}
+		if strings.HasPrefix(check.name, "Docker Desktop") && !check.skipped {
+			t.Errorf("systemd backend check %s ran, want it skipped", check.name)
+		}
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	failed := 0
+	for _, check := range doctorBackendChecks("systemd") {
+		if !check.ok {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("systemd backend without dockerd reported %d failure(s), want 1", failed)
+	}
+
+	for _, check := range doctorBackendChecks("remote") {
+		if !check.skipped {
+			t.Errorf("remote backend check %s ran, want every engine check skipped", check.name)
+		}
+	}
+}
+
+func TestWatchCommandRestarts(t *testing.T) {
+	defer func() {
+		waitClock = realClock{}
+		readinessCheck = isDockerReady
+		processCheck = isDockerDesktopRunning
+		*dockerCLI = "docker"
+		*maxRestarts = 3
+	}()
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	writeFakeDocker(t, dir, "echo run >> '"+runs+"'\nexit 3\n")
+	*dockerCLI = filepath.Join(dir, "docker")
+	*maxRestarts = 2
+	t.Setenv("HOME", t.TempDir())
+	processCheck = func() bool { return true }
+	countRuns := func() int {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), "run")
+	}
+
+	// The daemon is up, so the failure is the command's own and it is not re-run
+	readinessCheck = func() (string, bool) { return "info", true }
+	if code := watchCommand([]string{"ps"}); code != 3 || countRuns() != 1 {
+		t.Errorf("watchCommand() = %d after %d run(s), want 3 after 1 with the daemon up", code, countRuns())
+	}
+
+	// The daemon is gone after every run and comes back once waited for, until -max-restarts runs out
+	os.Remove(runs)
+	fake := newFakeClock()
+	waitClock = fake
+	probes := 0
+	readinessCheck = func() (string, bool) {
+		probes++
+		return "info", probes%2 == 0
+	}
+	done := make(chan int, 1)
+	go func() { done <- watchCommand([]string{"ps"}) }()
+	for restart := 0; restart < *maxRestarts; restart++ {
+		<-fake.registered
+		<-fake.registered
+		fake.Advance(2 * time.Second)
+	}
+
+	if code := <-done; code != 3 || countRuns() != 3 {
+		t.Errorf("watchCommand() = %d after %d run(s), want 3 after 3 (the first and -max-restarts 2)", code, countRuns())
+	}
+}
+
+func TestHoldOpen(t *testing.T) {
+	defer func() {
+		waitClock = realClock{}
+		*dockerCLI = "docker"
+	}()
+	dir := t.TempDir()
+	writeFakeDocker(t, dir, "[ \"$1\" != version ]\n")
+	*dockerCLI = filepath.Join(dir, "docker")
+	fake := newFakeClock()
+	waitClock = fake
+
+	type counts struct{ ticks, failed int }
+	done := make(chan counts, 1)
+	go func() {
+		ticks, failed := holdOpen(5 * time.Second)
+		done <- counts{ticks, failed}
+	}()
+	<-fake.registered
+	<-fake.registered
+
+	// Wait for each tick to be taken before moving on, or a later one would be dropped
+	tickTaken := func() {
+		for {
+			fake.mu.Lock()
+			pending := 0
+			for _, timer := range fake.timers {
+				if timer.period > 0 {
+					pending = len(timer.c)
+				}
+			}
+			fake.mu.Unlock()
+			if pending == 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	fake.Advance(2 * time.Second)
+	tickTaken()
+	fake.Advance(2 * time.Second)
+	tickTaken()
+	fake.Advance(time.Second)
+
+	if got := <-done; got != (counts{2, 2}) {
+		t.Errorf("holdOpen() = %d tick(s), %d failing, want 2 ticks that both saw docker version fail", got.ticks, got.failed)
+	}
+}
+
+func TestStartLinuxWithRetriesTimesOut(t *testing.T) {
+	defer func() {
+		*linuxStartCmd = ""
+		*timeout = 120
+		startCancelGrace = 5 * time.Second
+	}()
+	*linuxStartCmd = "sleep 30"
+	*timeout = 1
+	startCancelGrace = 100 * time.Millisecond
+
+	start := time.Now()
+	err := startLinuxWithRetries(3)
+	if err == nil || !strings.Contains(err.Error(), "-timeout") {
+		t.Errorf("startLinuxWithRetries() error = %v, want the hung start command cut off at -timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("startLinuxWithRetries() took %v with a 1s -timeout", elapsed)
+	}
+}
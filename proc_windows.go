@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// waitAbandoned is returned by WaitForSingleObject when the previous owner exited holding the mutex
+const waitAbandoned = 0x00000080
+
+// startLockAccess is SYNCHRONIZE|MUTEX_MODIFY_STATE, enough to wait on and release the start lock
+const startLockAccess = 0x00100000 | 0x0001
+
+// startLockSDDL grants every user startLockAccess, so one user's lock does not deny another's callers
+const startLockSDDL = "D:(A;;0x100001;;;WD)"
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procCreateMutex  = kernel32.NewProc("CreateMutexExW")
+	procReleaseMutex = kernel32.NewProc("ReleaseMutex")
+	procCtrlEvent    = kernel32.NewProc("GenerateConsoleCtrlEvent")
+
+	advapi32                 = syscall.NewLazyDLL("advapi32.dll")
+	procConvertSDDLToSecDesc = advapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+)
+
+// detachedProcess is the DETACHED_PROCESS creation flag, which syscall does not define
+const detachedProcess = 0x00000008
+
+// setProcessGroup runs cmd in a new process group so the whole tree can be signalled
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// killProcessTree kills cmd and every child it spawned. taskkill /T walks the tree from cmd's PID,
+// so once cmd has exited the children it orphaned are out of reach.
+func killProcessTree(cmd *exec.Cmd) error {
+	return terminateSpawned(cmd.Process)
+}
+
+// terminateSpawned kills a launch process and every child it spawned, such as Docker Desktop's backend
+func terminateSpawned(process *os.Process) error {
+	return runCmd(exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(process.Pid)))
+}
+
+// interruptProcessTree sends CTRL_BREAK to cmd's process group, which setProcessGroup created, so
+// console programs in it can exit cleanly
+func interruptProcessTree(cmd *exec.Cmd) error {
+	ok, _, err := procCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(cmd.Process.Pid))
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
+
+// detachProcess starts cmd without a console so it survives the parent and its window closing
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// startLockName resolves -start-lock to a mutex name; Global\ spans sessions, Local\ is per user session
+func startLockName(value string) string {
+	switch value {
+	case "system":
+		return `Global\docker-autostart`
+	case "user":
+		return `Local\docker-autostart`
+	}
+	return value
+}
+
+// acquireStartLock waits up to timeout to own the named mutex. A mutex belongs to the thread that
+// waited on it, so one locked OS thread owns it and also releases it when the returned func is called.
+func acquireStartLock(name string, timeout time.Duration) (func(), error) {
+	acquired := make(chan error, 1)
+	release := make(chan struct{})
+	released := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(released)
+
+		handle, err := waitStartLock(name, timeout)
+		acquired <- err
+		if err != nil {
+			return
+		}
+		<-release
+		procReleaseMutex.Call(uintptr(handle))
+		syscall.CloseHandle(handle)
+	}()
+	if err := <-acquired; err != nil {
+		return nil, err
+	}
+	return func() {
+		close(release)
+		<-released
+	}, nil
+}
+
+// waitStartLock opens or creates the named mutex, readable by every user, and waits up to timeout on it
+func waitStartLock(name string, timeout time.Duration) (syscall.Handle, error) {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	sddl, err := syscall.UTF16PtrFromString(startLockSDDL)
+	if err != nil {
+		return 0, err
+	}
+	var descriptor uintptr
+	if ok, _, err := procConvertSDDLToSecDesc.Call(uintptr(unsafe.Pointer(sddl)), 1, uintptr(unsafe.Pointer(&descriptor)), 0); ok == 0 {
+		return 0, fmt.Errorf("building mutex %s security descriptor: %v", name, err)
+	}
+	defer syscall.LocalFree(syscall.Handle(descriptor))
+	attrs := syscall.SecurityAttributes{SecurityDescriptor: descriptor}
+	attrs.Length = uint32(unsafe.Sizeof(attrs))
+
+	h, _, err := procCreateMutex.Call(uintptr(unsafe.Pointer(&attrs)), uintptr(unsafe.Pointer(namePtr)), 0, startLockAccess)
+	if h == 0 {
+		return 0, err
+	}
+	handle := syscall.Handle(h)
+	event, err := syscall.WaitForSingleObject(handle, uint32(timeout.Milliseconds()))
+	if event == syscall.WAIT_TIMEOUT {
+		syscall.CloseHandle(handle)
+		return 0, fmt.Errorf("mutex %s is still held by another caller after %v", name, timeout)
+	}
+	if err != nil || (event != syscall.WAIT_OBJECT_0 && event != waitAbandoned) {
+		syscall.CloseHandle(handle)
+		return 0, fmt.Errorf("waiting for mutex %s: %v", name, err)
+	}
+	return handle, nil
+}
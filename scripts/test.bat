@@ -8,7 +8,7 @@ REM Run unit tests
 go test -v ./...
 
 REM Build to ensure it compiles
-go build -o docker-autostart.exe main.go
+go build -o docker-autostart.exe .
 
 REM Test basic functionality
 docker-autostart.exe --help
@@ -10,7 +10,7 @@ echo "Running tests..."
 go test -v ./...
 
 # Build to ensure it compiles
-go build -o docker-autostart main.go
+go build -o docker-autostart .
 
 # Test basic functionality
 ./docker-autostart --help